@@ -2,23 +2,32 @@
 // Web Vital (CWV) values drop below a defined threshold.
 //
 // The Core Web Vitals are a set of metrics designed to measure the performance
-// of websites based on user experience. They are
+// of websites based on user experience. The metrics tracked are driven by the
+// CWVMetric registry populated in init(), which by default covers
 //   - Largest Contentful Paint (LCP)
 //   - Cumulative Layout Shift (CLS)
 //   - First Input Delay (FID)
+//   - Interaction to Next Paint (INP), Chrome's replacement for FID
+//   - Time to First Byte (TTFB)
+//
+// Additional metrics can be added with RegisterMetric without touching the
+// rest of the pipeline.
 // For more information on CWV, see https://web.dev/vitals
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"net/smtp"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -29,15 +38,71 @@ import (
 	"google.golang.org/api/iterator"
 )
 
-// The standard values for a good score according to the Chrome DevRel team.
-// The values are:
-//   - Largest Contentful Paint  2500 ms
-//   - Cumulative Layout Shift   0.1
-//   - First Input Delay         100 ms
+// The standard values for a good and a poor score according to the Chrome
+// DevRel team. Values between the good and poor thresholds are rated
+// "needs improvement". The values are:
+//   - Largest Contentful Paint  good <= 2500 ms, poor > 4000 ms
+//   - Cumulative Layout Shift   good <= 0.1,     poor > 0.25
+//   - First Input Delay        good <= 100 ms,  poor > 300 ms
+//   - Interaction to Next Paint good <= 200 ms, poor > 500 ms
+//   - Time to First Byte       good <= 800 ms,  poor > 1800 ms
+//
 // For more information see https://web.dev/vitals
-const StandardGoodLCP = 2500.0 // ms
-const StandardGoodCLS = 0.1    // unitless
-const StandardGoodFID = 100.0  // ms
+const StandardGoodLCP = 2500.0  // ms
+const StandardPoorLCP = 4000.0  // ms
+const StandardGoodCLS = 0.1     // unitless
+const StandardPoorCLS = 0.25    // unitless
+const StandardGoodFID = 100.0   // ms
+const StandardPoorFID = 300.0   // ms
+const StandardGoodINP = 200.0   // ms
+const StandardPoorINP = 500.0   // ms
+const StandardGoodTTFB = 800.0  // ms
+const StandardPoorTTFB = 1800.0 // ms
+
+// CWVMetric describes a single Core Web Vital metric tracked by the
+// pipeline: its display name, the unit it's reported in, its good and poor
+// thresholds, and the environment variable that can override the good
+// threshold. Values are checked against the good threshold only;
+// PoorThreshold is not read by the pipeline.
+type CWVMetric struct {
+	Name          string
+	Unit          string
+	GoodThreshold float64
+	PoorThreshold float64
+	EnvVar        string
+}
+
+// metricRegistry holds the registered metrics in registration order, so
+// email output is rendered in a stable, predictable order.
+var metricRegistry []CWVMetric
+
+// metricIndex maps a metric name to its position in metricRegistry, so
+// RegisterMetric can update an existing entry in place.
+var metricIndex = map[string]int{}
+
+// RegisterMetric adds a CWV metric to the registry, or replaces the
+// existing entry of the same name. Adding a new metric to the pipeline
+// requires only a single call to RegisterMetric; everything downstream
+// (thresholds, querying, alerting) iterates over the registry.
+func RegisterMetric(metric CWVMetric) {
+	if idx, ok := metricIndex[metric.Name]; ok {
+		metricRegistry[idx] = metric
+		return
+	}
+	metricIndex[metric.Name] = len(metricRegistry)
+	metricRegistry = append(metricRegistry, metric)
+}
+
+// init populates the default metric registry so the pipeline keeps working
+// out of the box, matching the metrics and thresholds it has always
+// supported plus INP and TTFB.
+func init() {
+	RegisterMetric(CWVMetric{Name: "LCP", Unit: "ms", GoodThreshold: StandardGoodLCP, PoorThreshold: StandardPoorLCP, EnvVar: "GOOD_LCP"})
+	RegisterMetric(CWVMetric{Name: "CLS", Unit: "", GoodThreshold: StandardGoodCLS, PoorThreshold: StandardPoorCLS, EnvVar: "GOOD_CLS"})
+	RegisterMetric(CWVMetric{Name: "FID", Unit: "ms", GoodThreshold: StandardGoodFID, PoorThreshold: StandardPoorFID, EnvVar: "GOOD_FID"})
+	RegisterMetric(CWVMetric{Name: "INP", Unit: "ms", GoodThreshold: StandardGoodINP, PoorThreshold: StandardPoorINP, EnvVar: "GOOD_INP"})
+	RegisterMetric(CWVMetric{Name: "TTFB", Unit: "ms", GoodThreshold: StandardGoodTTFB, PoorThreshold: StandardPoorTTFB, EnvVar: "GOOD_TTFB"})
+}
 
 // The top of the email message. The from and to addresses need to be filled in.
 // Exported for ease of testing.
@@ -66,7 +131,7 @@ var EmailHTMLStart = strings.Join([]string{
 	"<p>Your Core Web Vitals scores are not meeting your budgeted values:</p>",
 	"<table style=\"border-spacing: 0.5em\">",
 	"<caption>Core Web Vitals Issues</caption>",
-	"<thead><tr><th>Metric</th><th>Value</th><th>Budget</th><th>% Over</th></tr></thead>",
+	"<thead><tr><th>Metric</th><th>Value</th><th>Budget</th><th>% Over</th><th>Regression</th></tr></thead>",
 	"<tbody>",
 }, "\r\n")
 
@@ -77,6 +142,28 @@ var EmailHTMLEnd = strings.Join([]string{
 	"",
 }, "\r\n")
 
+// metricTableClose closes the main metrics table, for use when a segment
+// drill-down table follows it instead of EmailHTMLEnd closing the part
+// directly.
+var metricTableClose = "</tbody></table>"
+
+// segmentTableStart opens the segment drill-down table listing the worst
+// offending (page path, device category) segments.
+var segmentTableStart = strings.Join([]string{
+	"<h2>Worst-Performing Segments</h2>",
+	"<table style=\"border-spacing: 0.5em\">",
+	"<caption>Top Offending Segments</caption>",
+	"<thead><tr><th>Metric</th><th>Page</th><th>Device</th><th>p75</th><th>Budget</th><th>% Over</th><th>Samples</th></tr></thead>",
+	"<tbody>",
+}, "\r\n")
+
+// emailPartClose closes the html part and the email as a whole, following
+// whichever table (main metrics or segment drill-down) was rendered last.
+var emailPartClose = strings.Join([]string{
+	"--part-boundary--",
+	"",
+}, "\r\n")
+
 // cloudEvent represents the body of an Eventarc event. Only the parts of the
 // event that are required to determine if it's an event we're interested in
 // are included.
@@ -101,11 +188,210 @@ type cwvMeasurement struct {
 	Count       int
 }
 
+// DigestConfig holds the settings that control how the periodic digest email
+// is built. It is populated from environment variables by getDigestConfig.
+type DigestConfig struct {
+	// PeriodDays is the number of days the digest covers, read from
+	// DIGEST_PERIOD_DAYS.
+	PeriodDays int
+	// ComparePrevious controls whether the digest includes a comparison
+	// against the period immediately preceding it, read from
+	// DIGEST_COMPARE_PREVIOUS.
+	ComparePrevious bool
+}
+
+// metricDigest carries the aggregated trend for a single CWV metric over a
+// digest period, including a comparison against the previous period of the
+// same length when available.
+type metricDigest struct {
+	Name         string
+	CurrentP75   float64
+	PreviousP75  float64
+	DeltaPercent float64
+	Count        int
+}
+
+// RegressionConfig holds the settings that control regression detection.
+// It is populated from environment variables by getRegressionConfig.
+type RegressionConfig struct {
+	// BaselineDays is the number of preceding days used to compute the
+	// rolling baseline, read from BASELINE_DAYS.
+	BaselineDays int
+	// Sigma is the number of standard deviations above the baseline mean a
+	// value must exceed to be flagged, read from REGRESSION_SIGMA.
+	Sigma float64
+	// PercentThreshold is the relative change from the baseline mean, as a
+	// percentage, above which a value is flagged regardless of Sigma, read
+	// from REGRESSION_PCT.
+	PercentThreshold float64
+}
+
+// The defaults used when BASELINE_DAYS, REGRESSION_SIGMA, or REGRESSION_PCT
+// are unset.
+const DefaultBaselineDays = 28
+const DefaultRegressionSigma = 2.0
+const DefaultRegressionPercent = 20.0
+
+// getRegressionConfig retrieves the regression detection settings defined
+// in the BASELINE_DAYS, REGRESSION_SIGMA, and REGRESSION_PCT environment
+// variables, falling back to their defaults if unset or unparseable.
+func getRegressionConfig() RegressionConfig {
+	baselineDays := DefaultBaselineDays
+	if varValue, err := strconv.Atoi(os.Getenv("BASELINE_DAYS")); err == nil {
+		baselineDays = varValue
+	} else if _, exists := os.LookupEnv("BASELINE_DAYS"); exists {
+		log.Print("Problem converting BASELINE_DAYS. Using default.")
+	}
+
+	return RegressionConfig{
+		BaselineDays:     baselineDays,
+		Sigma:            parseEnvToFloat("REGRESSION_SIGMA", DefaultRegressionSigma),
+		PercentThreshold: parseEnvToFloat("REGRESSION_PCT", DefaultRegressionPercent),
+	}
+}
+
+// RegressionInfo describes how a metric's current value compares to its
+// rolling baseline.
+type RegressionInfo struct {
+	BaselineMean   float64
+	BaselineStdDev float64
+	ZScore         float64
+	PercentChange  float64
+}
+
+// detectRegression compares current against the rolling baseline computed
+// from history (the p75 values for the preceding BASELINE_DAYS days) and
+// reports whether it's a statistically significant regression: either more
+// than REGRESSION_SIGMA standard deviations above the baseline mean, or an
+// increase of more than REGRESSION_PCT relative to the mean. A metric
+// getting better (a lower p75) is never a regression, and the sigma test is
+// skipped when the baseline has zero variance so trivial noise on an
+// otherwise flat metric doesn't trip it. metric is unused by the
+// calculation itself but kept so callers and logs can identify which
+// metric's history was passed in.
+func detectRegression(metric string, current float64, history []float64) (bool, RegressionInfo) {
+	if len(history) == 0 {
+		return false, RegressionInfo{}
+	}
+
+	var sum float64
+	for _, v := range history {
+		sum += v
+	}
+	mean := sum / float64(len(history))
+
+	var sumSquaredDiff float64
+	for _, v := range history {
+		diff := v - mean
+		sumSquaredDiff += diff * diff
+	}
+	stdDev := math.Sqrt(sumSquaredDiff / float64(len(history)))
+
+	var zScore float64
+	if stdDev != 0 {
+		zScore = (current - mean) / stdDev
+	}
+
+	var percentChange float64
+	if mean != 0 {
+		percentChange = (current - mean) / mean * 100
+	}
+
+	config := getRegressionConfig()
+	isRegression := (stdDev > 0 && current > mean+config.Sigma*stdDev) || percentChange > config.PercentThreshold
+
+	return isRegression, RegressionInfo{
+		BaselineMean:   mean,
+		BaselineStdDev: stdDev,
+		ZScore:         zScore,
+		PercentChange:  percentChange,
+	}
+}
+
+// MetricReport carries a single reported CWV metric's value, its good
+// threshold, and how far over budget it is, expressed as a percentage. A
+// metric reported only because of a regression can be within its threshold,
+// in which case PercentOverBudget is zero or negative.
+type MetricReport struct {
+	Metric            string
+	Unit              string
+	Value             float64
+	Threshold         float64
+	PercentOverBudget float64
+	// IsRegression reports whether the value is a regression, and Regression
+	// is only meaningful when IsRegression is true; they describe a statistically significant deviation from the
+	// metric's rolling baseline, as opposed to a static threshold breach.
+	IsRegression bool
+	Regression   RegressionInfo
+}
+
+// CWVReport carries the metrics that are currently failing their threshold,
+// or showing a statistically significant regression from their baseline,
+// for a given GA4 export table, along with the date the table covers, so
+// each Notifier can render its own format.
+type CWVReport struct {
+	Table   string
+	Date    time.Time
+	Metrics []MetricReport
+	// Segments lists the worst-offending (page path, device category)
+	// combinations across all registered metrics, for drill-down; a
+	// segment's metric need not be one of those in Metrics. It may be empty
+	// if segmentation wasn't available or no segment exceeded its threshold
+	// with enough samples.
+	Segments []SegmentOverage
+}
+
+// Notifier sends a CWVReport to some destination, e.g. email, Slack, or
+// PagerDuty. Implementations are selected and configured via the NOTIFIERS
+// environment variable.
+type Notifier interface {
+	Notify(ctx context.Context, report CWVReport) error
+}
+
+// The default number of days a digest covers when DIGEST_PERIOD_DAYS is unset.
+const DefaultDigestPeriodDays = 7
+
+// The top of the digest email message. The from and to addresses need to be
+// filled in.
+var DigestEmailMessageHeader = strings.Join([]string{
+	"From: CWV Alerter <%s>",
+	"To: %s",
+	"Subject: Core Web Vitals Digest",
+	"MIME-Version: 1.0",
+	"Content-Type: multipart/alternative; boundary=\"part_boundary\"",
+	"",
+	"--part_boundary",
+	"Content-Type: text/plain; charset=\"UTF-8\"",
+	"Content-Transfer-Encoding: quoted-printable",
+	"",
+	"Your Core Web Vitals digest:",
+	""}, "\r\n")
+
+// The start of the html part of the digest email.
+var DigestEmailHTMLStart = strings.Join([]string{
+	"",
+	"--part-boundary",
+	"Content-Type: text/html; charset=\"UTF-8\"",
+	"Content-Transfer-Encoding: quoted-printable",
+	"",
+	"<h1>Core Web Vitals Digest</h1>",
+	"<p>Trends for your Core Web Vitals over the reporting period:</p>",
+	"<table style=\"border-spacing: 0.5em\">",
+	"<caption>Core Web Vitals Digest</caption>",
+	"<thead><tr><th>Metric</th><th>Current p75</th><th>Previous p75</th><th>Delta %</th><th>Count</th></tr></thead>",
+	"<tbody>",
+}, "\r\n")
+
+// The end of the html part of the digest email and the end of the email as a
+// whole.
+var DigestEmailHTMLEnd = EmailHTMLEnd
+
 // main is the entry point for the Cloud Run function. An http server is started
 // and waits for a request, which is then handed off to the handler.
 func main() {
 	log.Print("Starting Server...")
 	http.HandleFunc("/", handler)
+	http.HandleFunc("/digest", digestHandler)
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -133,16 +419,46 @@ func handler(writer http.ResponseWriter, req *http.Request) {
 	isGoodTable, _ := regexp.MatchString(`events_\d{8}`, tableName)
 
 	if service == "bigquery.googleapis.com" && method == "google.cloud.bigquery.v2.JobService.InsertJob" && isGoodTable {
-		lcp, cls, fid := getCWVValues(time.Now(), 7)
-		goodLCP, goodCLS, goodFID := areCWVValuesGood(lcp, cls, fid)
-		if !goodLCP || !goodCLS || !goodFID {
-			if err := sendAlertEmail(lcp, cls, fid); err != nil {
-				log.Fatal("Problem sending alert mail: ", err)
+		values, _ := getCWVValues(time.Now(), 7)
+		isGood := areCWVValuesGood(values)
+		history := getCWVHistory(time.Now(), getRegressionConfig().BaselineDays)
+
+		hasIssue := false
+		for name, value := range values {
+			isRegression, _ := detectRegression(name, value, history[name])
+			if !isGood[name] || isRegression {
+				hasIssue = true
+				break
+			}
+		}
+
+		if hasIssue {
+			segments := getSegmentedCWVValues(time.Now(), 7)
+			report := buildCWVReport(tableName, parseTableDate(tableName), values, history, segments)
+			if err := notifyAll(report); err != nil {
+				log.Print("Problem sending notifications: ", err)
 			}
 		}
 	}
 }
 
+// digestHandler is triggered by Cloud Scheduler on a recurring basis. It
+// aggregates CWV trends over the configured digest period and emails a
+// single summary to ALERT_RECEIVERS, regardless of whether any individual
+// metric is currently failing its threshold.
+func digestHandler(writer http.ResponseWriter, req *http.Request) {
+	log.Print("Starting digest handler")
+	config := getDigestConfig()
+	endDate := time.Now()
+	startDate := endDate.AddDate(0, 0, -config.PeriodDays)
+
+	digests := aggregateCWVOverPeriod(startDate, endDate, config)
+	if err := sendDigestEmail(digests); err != nil {
+		log.Print("Problem sending digest mail: ", err)
+		writer.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
 // getProjectID returns the current GCP project ID
 func getProjectID() string {
 	context := context.Background()
@@ -172,58 +488,95 @@ func getCloudEventDataFromRequest(req io.ReadCloser) (string, string, string) {
 	return service, method, tableName
 }
 
-// getCWVThresholds retrieves the Core Web Vital metric thresholds defined in
-// the GOOD_LCP, GOOD_CLS, and GOOD_FID environment variables. If the threshold
-// is not set, the standard values from the Chrome DevRel team (defined at the
-// top of the module for ease of maintenance) are used.
-func getCWVThresholds() (float64, float64, float64) {
-	// parseEnvToFloat is a utility function that takes an environment variable name
-	// and then returns the value as a float64 or the default value specified if the
-	// variable isn't defined or cannot be parsed.
-	parseEnvToFloat := func(varName string, defaultVal float64) float64 {
-		var varValue float64
-		var err error
-		if varValue, err = strconv.ParseFloat(os.Getenv(varName), 64); err != nil {
-			if _, exists := os.LookupEnv(varName); exists {
-				log.Printf("Problem converting %s threshold. Using default.", varName)
-			}
-			varValue = defaultVal
-		}
+// tableDateSuffix matches the YYYYMMDD date suffix of a GA4 daily export
+// table name, e.g. "events_20240102".
+var tableDateSuffix = regexp.MustCompile(`(\d{8})$`)
 
-		return varValue
+// parseTableDate extracts the date a GA4 export table covers from its name.
+// If tableName doesn't end in a YYYYMMDD suffix, the current time is
+// returned instead.
+func parseTableDate(tableName string) time.Time {
+	match := tableDateSuffix.FindStringSubmatch(tableName)
+	if match == nil {
+		return time.Now()
+	}
+	date, err := time.Parse("20060102", match[1])
+	if err != nil {
+		return time.Now()
 	}
 
-	LCPThresh := parseEnvToFloat("GOOD_LCP", StandardGoodLCP)
-	CLSThresh := parseEnvToFloat("GOOD_CLS", StandardGoodCLS)
-	FIDThresh := parseEnvToFloat("GOOD_FID", StandardGoodFID)
+	return date
+}
 
-	return LCPThresh, CLSThresh, FIDThresh
+// parseEnvToFloat takes an environment variable name and returns its value
+// as a float64, or the default value specified if the variable isn't
+// defined or cannot be parsed.
+func parseEnvToFloat(varName string, defaultVal float64) float64 {
+	varValue, err := strconv.ParseFloat(os.Getenv(varName), 64)
+	if err != nil {
+		if _, exists := os.LookupEnv(varName); exists {
+			log.Printf("Problem converting %s threshold. Using default.", varName)
+		}
+		varValue = defaultVal
+	}
+
+	return varValue
 }
 
-// areCWVValuesGood returns whether the CWV metrics meet the good threshold set
-// in the environment variables GOOD_LCP, GOOD_CLS, and GOOD_FID.
-// The metrics are returned in the order Largest Contentful Paint (LCP),
-// Cumulative Layout Shift (CLS), First Input Delay (FID).
-func areCWVValuesGood(lcp float64, cls float64, fid float64) (bool, bool, bool) {
-	goodLCP, goodCLS, goodFID := getCWVThresholds()
-	var isLCPGood, isCLSGood, isFIDGood bool // bools default to false
+// getCWVThresholds retrieves the good-score threshold for every registered
+// CWV metric, keyed by metric name. Each threshold is read from the
+// metric's EnvVar; if that variable is not set or cannot be parsed, the
+// metric's registered GoodThreshold is used.
+func getCWVThresholds() map[string]float64 {
+	thresholds := make(map[string]float64, len(metricRegistry))
+	for _, metric := range metricRegistry {
+		thresholds[metric.Name] = parseEnvToFloat(metric.EnvVar, metric.GoodThreshold)
+	}
+
+	return thresholds
+}
 
-	if lcp <= goodLCP {
-		isLCPGood = true
+// getDigestConfig retrieves the digest settings defined in the
+// DIGEST_PERIOD_DAYS and DIGEST_COMPARE_PREVIOUS environment variables. If
+// DIGEST_PERIOD_DAYS is not set or cannot be parsed, DefaultDigestPeriodDays
+// is used. If DIGEST_COMPARE_PREVIOUS is not set or cannot be parsed, it
+// defaults to true.
+func getDigestConfig() DigestConfig {
+	periodDays := DefaultDigestPeriodDays
+	if varValue, err := strconv.Atoi(os.Getenv("DIGEST_PERIOD_DAYS")); err == nil {
+		periodDays = varValue
+	} else if _, exists := os.LookupEnv("DIGEST_PERIOD_DAYS"); exists {
+		log.Print("Problem converting DIGEST_PERIOD_DAYS. Using default.")
 	}
-	if cls <= goodCLS {
-		isCLSGood = true
+
+	comparePrevious := true
+	if varValue, err := strconv.ParseBool(os.Getenv("DIGEST_COMPARE_PREVIOUS")); err == nil {
+		comparePrevious = varValue
+	} else if _, exists := os.LookupEnv("DIGEST_COMPARE_PREVIOUS"); exists {
+		log.Print("Problem converting DIGEST_COMPARE_PREVIOUS. Using default.")
 	}
-	if fid <= goodFID {
-		isFIDGood = true
+
+	return DigestConfig{PeriodDays: periodDays, ComparePrevious: comparePrevious}
+}
+
+// areCWVValuesGood returns whether each CWV metric in values meets its good
+// threshold, keyed by metric name.
+func areCWVValuesGood(values map[string]float64) map[string]bool {
+	thresholds := getCWVThresholds()
+	isGood := make(map[string]bool, len(values))
+	for name, value := range values {
+		isGood[name] = value <= thresholds[name]
 	}
 
-	return isLCPGood, isCLSGood, isFIDGood
+	return isGood
 }
 
-// getCWVValues fetches the CWV values starting on the given date for the given
-// interval in days. The metrics are returned in the order LCP, CLS, FID.
-func getCWVValues(startDate time.Time, numDays int) (float64, float64, float64) {
+// getCWVValues fetches the CWV values and sample counts starting on the
+// given date for the given interval in days, both keyed by metric name for
+// every metric present in the BigQuery result. Metric names not present in
+// the registry are ignored, so new metrics start showing up in results once
+// registered.
+func getCWVValues(startDate time.Time, numDays int) (map[string]float64, map[string]int) {
 	ctx := context.Background()
 	projectID := getProjectID()
 	bqClient, err := bigquery.NewClient(ctx, projectID)
@@ -232,7 +585,7 @@ func getCWVValues(startDate time.Time, numDays int) (float64, float64, float64)
 	}
 	analyticsID := os.Getenv("ANALYTICS_ID")
 	bqProcedureName := "analytics_" + analyticsID + "get_cwv_p75_for_date"
-	startDateString := "PARSE_DATE('%Y%m%d', '" + startDate.Format("20060201") + "')"
+	startDateString := "PARSE_DATE('%Y%m%d', '" + startDate.Format("20060102") + "')"
 	bqQuery := bqClient.Query(fmt.Sprintf("CALL %s(%s, %d)", bqProcedureName, startDateString, numDays))
 
 	bqResult, err := bqQuery.Read(ctx)
@@ -240,90 +593,603 @@ func getCWVValues(startDate time.Time, numDays int) (float64, float64, float64)
 		log.Fatal("Problem querying BigQuery: ", err)
 	}
 
-	lcp := 0.0
-	cls := 0.0
-	fid := 0.0
+	values := make(map[string]float64, len(metricRegistry))
+	counts := make(map[string]int, len(metricRegistry))
 	for {
 		var m cwvMeasurement
 		err := bqResult.Next(&m)
 		if err == iterator.Done {
 			break
 		}
-		switch name := m.Metric_name; name {
-		case "LCP":
-			lcp = m.P75
-		case "CLS":
-			cls = m.P75
-		case "FID":
-			fid = m.P75
+		if _, ok := metricIndex[m.Metric_name]; ok {
+			values[m.Metric_name] = m.P75
+			counts[m.Metric_name] = m.Count
 		}
 	}
 
-	return lcp, cls, fid
+	return values, counts
+}
+
+// dailyCWVMeasurement mirrors a single row of the per-day p75 series
+// returned for a regression baseline window, keyed by metric and day.
+type dailyCWVMeasurement struct {
+	Metric_name string
+	Day         string
+	P75         float64
+}
+
+// getCWVHistory fetches the per-day p75 history for every registered metric
+// over the numDays before endDate, oldest first, in a single BigQuery read.
+func getCWVHistory(endDate time.Time, numDays int) map[string][]float64 {
+	ctx := context.Background()
+	projectID := getProjectID()
+	bqClient, err := bigquery.NewClient(ctx, projectID)
+	if err != nil {
+		log.Fatal("Problem connecting to BigQuery: ", err)
+	}
+	analyticsID := os.Getenv("ANALYTICS_ID")
+	bqProcedureName := "analytics_" + analyticsID + "get_cwv_p75_daily_for_range"
+	startDateString := "PARSE_DATE('%Y%m%d', '" + endDate.AddDate(0, 0, -numDays).Format("20060102") + "')"
+	bqQuery := bqClient.Query(fmt.Sprintf("CALL %s(%s, %d)", bqProcedureName, startDateString, numDays))
+
+	bqResult, err := bqQuery.Read(ctx)
+	if err != nil {
+		log.Fatal("Problem querying BigQuery: ", err)
+	}
+
+	byDay := map[string]map[string]float64{}
+	var days []string
+	for {
+		var m dailyCWVMeasurement
+		err := bqResult.Next(&m)
+		if err == iterator.Done {
+			break
+		}
+		if _, ok := metricIndex[m.Metric_name]; !ok {
+			continue
+		}
+		if _, seen := byDay[m.Day]; !seen {
+			days = append(days, m.Day)
+			byDay[m.Day] = map[string]float64{}
+		}
+		byDay[m.Day][m.Metric_name] = m.P75
+	}
+	sort.Strings(days)
+
+	history := make(map[string][]float64, len(metricRegistry))
+	for _, day := range days {
+		for _, metric := range metricRegistry {
+			history[metric.Name] = append(history[metric.Name], byDay[day][metric.Name])
+		}
+	}
+
+	return history
+}
+
+// SegmentedCWV is a single metric's p75 and sample count for one page path
+// and device category, as returned by getSegmentedCWVValues.
+type SegmentedCWV struct {
+	Metric         string
+	PagePath       string
+	DeviceCategory string
+	P75            float64
+	Count          int
+}
+
+// segmentedMeasurement mirrors a single row returned by the segmented CWV
+// query.
+type segmentedMeasurement struct {
+	Metric_name     string
+	Page_path       string
+	Device_category string
+	P75             float64
+	Count           int
+}
+
+// SegmentConfig holds the settings that control how segment drill-downs are
+// filtered and sized. It is populated from environment variables by
+// getSegmentConfig.
+type SegmentConfig struct {
+	// MinSamples is the minimum sample count a (path, device) segment must
+	// have to be considered, read from MIN_SEGMENT_SAMPLES. Segments with
+	// fewer samples are suppressed as noise.
+	MinSamples int
+	// TopN is the maximum number of worst-offending segments included in an
+	// alert, read from TOP_N_SEGMENTS.
+	TopN int
+}
+
+// The defaults used when MIN_SEGMENT_SAMPLES or TOP_N_SEGMENTS are unset.
+const DefaultMinSegmentSamples = 100
+const DefaultTopNSegments = 10
+
+// getSegmentConfig retrieves the segment drill-down settings defined in the
+// MIN_SEGMENT_SAMPLES and TOP_N_SEGMENTS environment variables, falling back
+// to their defaults if unset or unparseable.
+func getSegmentConfig() SegmentConfig {
+	minSamples := DefaultMinSegmentSamples
+	if varValue, err := strconv.Atoi(os.Getenv("MIN_SEGMENT_SAMPLES")); err == nil {
+		minSamples = varValue
+	} else if _, exists := os.LookupEnv("MIN_SEGMENT_SAMPLES"); exists {
+		log.Print("Problem converting MIN_SEGMENT_SAMPLES. Using default.")
+	}
+
+	topN := DefaultTopNSegments
+	if varValue, err := strconv.Atoi(os.Getenv("TOP_N_SEGMENTS")); err == nil {
+		topN = varValue
+	} else if _, exists := os.LookupEnv("TOP_N_SEGMENTS"); exists {
+		log.Print("Problem converting TOP_N_SEGMENTS. Using default.")
+	}
+
+	return SegmentConfig{MinSamples: minSamples, TopN: topN}
 }
 
-// sendAlertEmail retrieves the environment variables required to send the alert
-// email using the given CWV values. The required environment variables are:
-//  - ALERT_RECEIVERS: a comma-separated list of email addresses to receive the alert
-//  - EMAIL_FROM: the email address to use as the alert sender
-//  - EMAIL_SERVER: the address of the SMTP server to use
-//  - EMAIL_USER: the username to use when authenticating with the SMTP server
-//  - EMAIL_PASS: the password to use when authenticating with the SMTP server
-func sendAlertEmail(lcp float64, cls float64, fid float64) error {
+// getSegmentedCWVValues fetches the per-page-path, per-device-category p75
+// and sample count for every registered metric over the numDays days up to
+// and including startDate. Unlike getCWVValues, this queries an inline
+// parameterized query rather than a stored procedure, so the segmentation
+// dimensions can evolve without redeploying SQL.
+func getSegmentedCWVValues(startDate time.Time, numDays int) []SegmentedCWV {
+	ctx := context.Background()
+	projectID := getProjectID()
+	bqClient, err := bigquery.NewClient(ctx, projectID)
+	if err != nil {
+		log.Fatal("Problem connecting to BigQuery: ", err)
+	}
+	analyticsID := os.Getenv("ANALYTICS_ID")
+	eventsTable := "analytics_" + analyticsID + ".events_*"
+
+	bqQuery := bqClient.Query(`
+		SELECT
+			metric_name,
+			page_path,
+			device_category,
+			APPROX_QUANTILES(value, 100)[OFFSET(75)] AS p75,
+			COUNT(*) AS count
+		FROM ` + "`" + eventsTable + "`" + `
+		WHERE _TABLE_SUFFIX BETWEEN @start_date AND @end_date
+		GROUP BY metric_name, page_path, device_category
+	`)
+	bqQuery.Parameters = []bigquery.QueryParameter{
+		{Name: "start_date", Value: startDate.AddDate(0, 0, -(numDays - 1)).Format("20060102")},
+		{Name: "end_date", Value: startDate.Format("20060102")},
+	}
+
+	bqResult, err := bqQuery.Read(ctx)
+	if err != nil {
+		log.Fatal("Problem querying BigQuery: ", err)
+	}
+
+	var segments []SegmentedCWV
+	for {
+		var m segmentedMeasurement
+		err := bqResult.Next(&m)
+		if err == iterator.Done {
+			break
+		}
+		if _, ok := metricIndex[m.Metric_name]; !ok {
+			continue
+		}
+		segments = append(segments, SegmentedCWV{
+			Metric:         m.Metric_name,
+			PagePath:       m.Page_path,
+			DeviceCategory: m.Device_category,
+			P75:            m.P75,
+			Count:          m.Count,
+		})
+	}
+
+	return segments
+}
+
+// SegmentOverage describes how far a single (path, device) segment's p75 is
+// over its metric's threshold, for inclusion in an alert's drill-down.
+type SegmentOverage struct {
+	Metric            string
+	PagePath          string
+	DeviceCategory    string
+	P75               float64
+	Threshold         float64
+	PercentOverBudget float64
+	Count             int
+}
+
+// buildSegmentOverages filters segments down to those whose p75 exceeds
+// their metric's threshold and whose sample count is at least
+// config.MinSamples, computes how far over budget each is, and
+// returns the config.TopN worst offenders sorted by percent over budget,
+// descending.
+func buildSegmentOverages(segments []SegmentedCWV, thresholds map[string]float64, config SegmentConfig) []SegmentOverage {
+	var overages []SegmentOverage
+	for _, segment := range segments {
+		if segment.Count < config.MinSamples {
+			continue
+		}
+		threshold := thresholds[segment.Metric]
+		if segment.P75 <= threshold {
+			continue
+		}
+		overages = append(overages, SegmentOverage{
+			Metric:            segment.Metric,
+			PagePath:          segment.PagePath,
+			DeviceCategory:    segment.DeviceCategory,
+			P75:               segment.P75,
+			Threshold:         threshold,
+			PercentOverBudget: (segment.P75 - threshold) / threshold * 100,
+			Count:             segment.Count,
+		})
+	}
+
+	sort.Slice(overages, func(i, j int) bool {
+		return overages[i].PercentOverBudget > overages[j].PercentOverBudget
+	})
+	if len(overages) > config.TopN {
+		overages = overages[:config.TopN]
+	}
+
+	return overages
+}
+
+// aggregateCWVOverPeriod computes the current p75 for each CWV metric over
+// [startDate, endDate), and, when config.ComparePrevious is true, the p75 for
+// the immediately preceding period of the same length. The delta percent is
+// the change of the current p75 relative to the previous p75.
+func aggregateCWVOverPeriod(startDate time.Time, endDate time.Time, config DigestConfig) []metricDigest {
+	numDays := int(endDate.Sub(startDate).Hours() / 24)
+
+	current, currentCounts := getCWVValues(startDate, numDays)
+
+	previous := map[string]float64{}
+	if config.ComparePrevious {
+		previousStart := startDate.AddDate(0, 0, -numDays)
+		previous, _ = getCWVValues(previousStart, numDays)
+	}
+
+	deltaPercent := func(current float64, previous float64) float64 {
+		if previous == 0 {
+			return 0
+		}
+		return (current - previous) / previous * 100
+	}
+
+	digests := make([]metricDigest, 0, len(metricRegistry))
+	for _, metric := range metricRegistry {
+		digests = append(digests, metricDigest{
+			Name:         metric.Name,
+			CurrentP75:   current[metric.Name],
+			PreviousP75:  previous[metric.Name],
+			DeltaPercent: deltaPercent(current[metric.Name], previous[metric.Name]),
+			Count:        currentCounts[metric.Name],
+		})
+	}
+
+	return digests
+}
+
+// buildCWVReport filters values down to the metrics that are currently
+// failing their threshold or showing a statistically significant
+// regression from their history, and packages them, along with table and
+// date context and the worst-offending segments drawn from segments, into a
+// CWVReport for the configured Notifiers to send.
+func buildCWVReport(table string, date time.Time, values map[string]float64, history map[string][]float64, segments []SegmentedCWV) CWVReport {
+	isGood := areCWVValuesGood(values)
+	thresholds := getCWVThresholds()
+
+	var metrics []MetricReport
+	for _, metric := range metricRegistry {
+		value, ok := values[metric.Name]
+		if !ok {
+			continue
+		}
+		isRegression, regression := detectRegression(metric.Name, value, history[metric.Name])
+		if isGood[metric.Name] && !isRegression {
+			continue
+		}
+		threshold := thresholds[metric.Name]
+		metrics = append(metrics, MetricReport{
+			Metric:            metric.Name,
+			Unit:              metric.Unit,
+			Value:             value,
+			Threshold:         threshold,
+			PercentOverBudget: (value - threshold) / threshold * 100,
+			IsRegression:      isRegression,
+			Regression:        regression,
+		})
+	}
+
+	segmentOverages := buildSegmentOverages(segments, thresholds, getSegmentConfig())
+
+	return CWVReport{Table: table, Date: date, Metrics: metrics, Segments: segmentOverages}
+}
+
+// getNotifiers builds the list of configured Notifiers from the
+// comma-separated NOTIFIERS environment variable, defaulting to "smtp" to
+// preserve existing behavior when it is unset. A notifier whose required
+// configuration is missing is logged and skipped rather than failing the
+// whole list.
+func getNotifiers() []Notifier {
+	names := os.Getenv("NOTIFIERS")
+	if names == "" {
+		names = "smtp"
+	}
+
+	var notifiers []Notifier
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "smtp":
+			notifiers = append(notifiers, smtpNotifier{})
+		case "slack":
+			if webhookURL := os.Getenv("SLACK_WEBHOOK_URL"); webhookURL != "" {
+				notifiers = append(notifiers, slackNotifier{WebhookURL: webhookURL})
+			} else {
+				log.Print("NOTIFIERS includes slack but SLACK_WEBHOOK_URL is not set, skipping")
+			}
+		case "webhook":
+			if webhookURL := os.Getenv("WEBHOOK_URL"); webhookURL != "" {
+				notifiers = append(notifiers, webhookNotifier{URL: webhookURL})
+			} else {
+				log.Print("NOTIFIERS includes webhook but WEBHOOK_URL is not set, skipping")
+			}
+		case "pagerduty":
+			if routingKey := os.Getenv("PAGERDUTY_ROUTING_KEY"); routingKey != "" {
+				notifiers = append(notifiers, pagerdutyNotifier{RoutingKey: routingKey})
+			} else {
+				log.Print("NOTIFIERS includes pagerduty but PAGERDUTY_ROUTING_KEY is not set, skipping")
+			}
+		default:
+			log.Printf("Unknown notifier %q in NOTIFIERS, skipping", name)
+		}
+	}
+
+	return notifiers
+}
+
+// notifyAll sends report to every configured Notifier, continuing on to
+// the rest even if one fails, and returns a single error aggregating any
+// failures.
+func notifyAll(report CWVReport) error {
+	var errMsgs []string
+	for _, notifier := range getNotifiers() {
+		if err := notifier.Notify(context.Background(), report); err != nil {
+			errMsgs = append(errMsgs, err.Error())
+		}
+	}
+	if len(errMsgs) > 0 {
+		return fmt.Errorf("%d notifier(s) failed: %s", len(errMsgs), strings.Join(errMsgs, "; "))
+	}
+
+	return nil
+}
+
+// smtpNotifier sends a CWVReport as an email, using the same message
+// format and environment variables (ALERT_RECEIVERS, EMAIL_FROM,
+// EMAIL_SERVER, EMAIL_USER, EMAIL_PASS) as the original alerting behavior.
+type smtpNotifier struct{}
+
+func (smtpNotifier) Notify(ctx context.Context, report CWVReport) error {
 	toAddresses := os.Getenv("ALERT_RECEIVERS")
 	fromAddress := os.Getenv("EMAIL_FROM")
-	message := createEmailMessage(fromAddress, toAddresses, lcp, cls, fid)
+	message := createEmailMessage(fromAddress, toAddresses, report)
 
 	mailServer := os.Getenv("EMAIL_SERVER")
 	mailUser := os.Getenv("EMAIL_USER")
 	mailPass := os.Getenv("EMAIL_PASS")
 	mailAuth := smtp.PlainAuth("", mailUser, mailPass, mailServer)
-	err := smtp.SendMail(mailServer, mailAuth, fromAddress, strings.Split(toAddresses, ","), message)
 
-	return err
+	return smtp.SendMail(mailServer, mailAuth, fromAddress, strings.Split(toAddresses, ","), message)
 }
 
-// createEmailMessage builds the byte array to be used as the message when
-// sending an email. It is assumed that at least one of the metrics is failing.
-// The message is a multipart MIME message with a plain text and an HTML part.
-func createEmailMessage(from string, to string, lcp float64, cls float64, fid float64) []byte {
-	LCPIsGood, CLSIsGood, FIDIsGood := areCWVValuesGood(lcp, cls, fid)
-	goodLCP, goodCLS, goodFID := getCWVThresholds()
-	lcpPercent := lcp / goodLCP * 100
-	clsPercent := cls / goodCLS * 100
-	fidPercent := fid / goodFID * 100
+// slackNotifier sends a CWVReport to a Slack incoming webhook as a plain
+// text message.
+type slackNotifier struct {
+	WebhookURL string
+}
 
-	message := fmt.Sprintf(EmailMessageHeader, from, to)
+func (n slackNotifier) Notify(ctx context.Context, report CWVReport) error {
+	payload, err := json.Marshal(map[string]string{"text": formatReportAsText(report)})
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.Post(n.WebhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("slack webhook returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// webhookNotifier sends a CWVReport as a JSON payload to a generic HTTP
+// webhook.
+type webhookNotifier struct {
+	URL string
+}
+
+func (n webhookNotifier) Notify(ctx context.Context, report CWVReport) error {
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.Post(n.URL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returned status %d", n.URL, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// pagerDutyEventsURL is the PagerDuty Events API v2 endpoint used to
+// trigger incidents.
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// pagerdutyNotifier triggers a PagerDuty incident via the Events API v2.
+type pagerdutyNotifier struct {
+	RoutingKey string
+}
+
+func (n pagerdutyNotifier) Notify(ctx context.Context, report CWVReport) error {
+	payload, err := json.Marshal(map[string]any{
+		"routing_key":  n.RoutingKey,
+		"event_action": "trigger",
+		"payload": map[string]any{
+			"summary":        fmt.Sprintf("Core Web Vitals alert for table %s", report.Table),
+			"source":         report.Table,
+			"severity":       "warning",
+			"timestamp":      report.Date.Format(time.RFC3339),
+			"custom_details": report.Metrics,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.Post(pagerDutyEventsURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("pagerduty events API returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// formatReportAsText renders a CWVReport as a short, human-readable summary
+// suitable for chat-style notifiers like Slack.
+func formatReportAsText(report CWVReport) string {
+	lines := []string{fmt.Sprintf("Core Web Vitals alert for table %s (%s):", report.Table, report.Date.Format("2006-01-02"))}
+	for _, metric := range report.Metrics {
+		line := fmt.Sprintf("- %s: %.0f (threshold %.0f, %.0f%% over budget)", metric.Metric, metric.Value, metric.Threshold, metric.PercentOverBudget)
+		if metric.IsRegression {
+			line += fmt.Sprintf(" [regression: z=%.2f, %.0f%% change from baseline]", metric.Regression.ZScore, metric.Regression.PercentChange)
+		}
+		lines = append(lines, line)
+	}
 
-	if !LCPIsGood {
-		message += fmt.Sprintf("LCP of %.0f ms is %.0f%% of %.0f ms budget.\r\n", lcp, lcpPercent, goodLCP)
+	if len(report.Segments) > 0 {
+		lines = append(lines, "Worst-performing segments:")
+		for _, segment := range report.Segments {
+			lines = append(lines, fmt.Sprintf("- %s on %s (%s): %.0f (%.0f%% over budget, %d samples)",
+				segment.Metric, segment.PagePath, segment.DeviceCategory, segment.P75, segment.PercentOverBudget, segment.Count))
+		}
 	}
-	if !CLSIsGood {
-		message += fmt.Sprintf("CLS of %.0f is %.0f%% of %.0f budget.\r\n", cls, clsPercent, goodCLS)
+
+	return strings.Join(lines, "\n")
+}
+
+// unitSuffix returns unit prefixed with a space, or the empty string if
+// unit is unitless, for use in prose where the value and unit need a
+// separator.
+func unitSuffix(unit string) string {
+	if unit == "" {
+		return ""
+	}
+	return " " + unit
+}
+
+// createEmailMessage builds the byte array to be used as the message when
+// sending an email. It is assumed that report.Metrics is not empty. The
+// message is a multipart MIME message with a plain text and an HTML part,
+// with one row per entry in report.Metrics, in the order given, followed by
+// a drill-down table of report.Segments when there are any.
+func createEmailMessage(from string, to string, report CWVReport) []byte {
+	message := fmt.Sprintf(EmailMessageHeader, from, to)
+
+	for _, metric := range report.Metrics {
+		percent := metric.Value / metric.Threshold * 100
+		line := fmt.Sprintf("%s of %.0f%s is %.0f%% of %.0f%s budget.",
+			metric.Metric, metric.Value, unitSuffix(metric.Unit), percent, metric.Threshold, unitSuffix(metric.Unit))
+		if metric.IsRegression {
+			line += fmt.Sprintf(" Regression detected: %.0f%% change from baseline mean %.0f%s (z=%.2f).",
+				metric.Regression.PercentChange, metric.Regression.BaselineMean, unitSuffix(metric.Unit), metric.Regression.ZScore)
+		}
+		message += line + "\r\n"
 	}
-	if !FIDIsGood {
-		message += fmt.Sprintf("FID of %.0f ms is %.0f%% of %.0f ms budget.\r\n", fid, fidPercent, goodFID)
+	for _, segment := range report.Segments {
+		message += fmt.Sprintf("Worst segment for %s: %s (%s) at %.0f, %.0f%% over budget (%d samples).\r\n",
+			segment.Metric, segment.PagePath, segment.DeviceCategory, segment.P75, segment.PercentOverBudget, segment.Count)
 	}
 
 	message += EmailHTMLStart
 
-	if !LCPIsGood {
-		message += "<tr><td style=\"background: lightgray; font-weight: bolder; text-align: center\">LCP</td>" +
-			fmt.Sprintf("<td>%.0fms</td><td>%.0fms</td><td style=\"color: red\">%.0f%%</td>", lcp, goodLCP, lcpPercent) +
+	for _, metric := range report.Metrics {
+		percent := metric.Value / metric.Threshold * 100
+		regressionCell := "No"
+		if metric.IsRegression {
+			regressionCell = fmt.Sprintf("Yes (z=%.2f)", metric.Regression.ZScore)
+		}
+		message += "<tr><td style=\"background: lightgray; font-weight: bolder; text-align: center\">" + metric.Metric + "</td>" +
+			fmt.Sprintf("<td>%.0f%s</td><td>%.0f%s</td><td style=\"color: red\">%.0f%%</td><td>%s</td>",
+				metric.Value, metric.Unit, metric.Threshold, metric.Unit, percent, regressionCell) +
 			"</tr>"
 	}
-	if !CLSIsGood {
-		message += "<tr><td style=\"background: lightgray; font-weight: bolder; text-align: center\">CLS</td>" +
-			fmt.Sprintf("<td>%.0f</td><td>%.0f</td><td style=\"color: red\">%.0f%%</td>", cls, goodCLS, clsPercent) +
+
+	if len(report.Segments) == 0 {
+		message += EmailHTMLEnd
+		return []byte(message)
+	}
+
+	message += metricTableClose
+	message += segmentTableStart
+	for _, segment := range report.Segments {
+		message += "<tr><td style=\"background: lightgray; font-weight: bolder; text-align: center\">" + segment.Metric + "</td>" +
+			fmt.Sprintf("<td>%s</td><td>%s</td><td>%.0f</td><td>%.0f</td><td style=\"color: red\">%.0f%%</td><td>%d</td>",
+				segment.PagePath, segment.DeviceCategory, segment.P75, segment.Threshold, segment.PercentOverBudget, segment.Count) +
 			"</tr>"
 	}
-	if !FIDIsGood {
-		message += "<tr><td style=\"background: lightgray; font-weight: bolder; text-align: center\">FID</td>" +
-			fmt.Sprintf("<td>%.0fms</td><td>%.0fms</td><td style=\"color: red\">%.0f%%</td>", fid, goodFID, fidPercent) +
+	message += emailPartClose
+
+	return []byte(message)
+}
+
+// sendDigestEmail retrieves the environment variables required to send the
+// digest email using the given per-metric digests. The required environment
+// variables are the same as smtpNotifier's: ALERT_RECEIVERS, EMAIL_FROM,
+// EMAIL_SERVER, EMAIL_USER, and EMAIL_PASS.
+func sendDigestEmail(digests []metricDigest) error {
+	toAddresses := os.Getenv("ALERT_RECEIVERS")
+	fromAddress := os.Getenv("EMAIL_FROM")
+	message := createDigestEmailMessage(fromAddress, toAddresses, digests)
+
+	mailServer := os.Getenv("EMAIL_SERVER")
+	mailUser := os.Getenv("EMAIL_USER")
+	mailPass := os.Getenv("EMAIL_PASS")
+	mailAuth := smtp.PlainAuth("", mailUser, mailPass, mailServer)
+	err := smtp.SendMail(mailServer, mailAuth, fromAddress, strings.Split(toAddresses, ","), message)
+
+	return err
+}
+
+// createDigestEmailMessage builds the byte array to be used as the message
+// when sending a digest email. The message is a multipart MIME message with
+// a plain text and an HTML part, listing one row per metric in digests.
+func createDigestEmailMessage(from string, to string, digests []metricDigest) []byte {
+	message := fmt.Sprintf(DigestEmailMessageHeader, from, to)
+
+	for _, d := range digests {
+		message += fmt.Sprintf("%s p75 is %.0f, a %.0f%% change from %.0f in the previous period.\r\n",
+			d.Name, d.CurrentP75, d.DeltaPercent, d.PreviousP75)
+	}
+
+	message += DigestEmailHTMLStart
+
+	for _, d := range digests {
+		message += "<tr><td style=\"background: lightgray; font-weight: bolder; text-align: center\">" + d.Name + "</td>" +
+			fmt.Sprintf("<td>%.0f</td><td>%.0f</td><td>%.0f%%</td><td>%d</td>", d.CurrentP75, d.PreviousP75, d.DeltaPercent, d.Count) +
 			"</tr>"
 	}
 
-	message += EmailHTMLEnd
+	message += DigestEmailHTMLEnd
 
 	return []byte(message)
 }
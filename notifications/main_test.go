@@ -19,6 +19,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func Test_getCloudEventDataFromRequest(t *testing.T) {
@@ -61,6 +62,24 @@ func Test_getCloudEventDataFromRequest(t *testing.T) {
 	}
 }
 
+func Test_RegisterMetric(t *testing.T) {
+	registeredBefore := len(metricRegistry)
+
+	RegisterMetric(CWVMetric{Name: "TEST_METRIC", Unit: "ms", GoodThreshold: 42, EnvVar: "GOOD_TEST_METRIC"})
+	if len(metricRegistry) != registeredBefore+1 {
+		t.Errorf("Expected a new metric to be appended, registry has %d entries", len(metricRegistry))
+	}
+
+	// re-registering the same name updates in place rather than appending.
+	RegisterMetric(CWVMetric{Name: "TEST_METRIC", Unit: "ms", GoodThreshold: 100, EnvVar: "GOOD_TEST_METRIC"})
+	if len(metricRegistry) != registeredBefore+1 {
+		t.Errorf("Expected re-registering a metric to update in place, registry has %d entries", len(metricRegistry))
+	}
+	if metricRegistry[metricIndex["TEST_METRIC"]].GoodThreshold != 100 {
+		t.Error("Expected re-registered metric's threshold to be updated")
+	}
+}
+
 func Test_getCWVThresholds(t *testing.T) {
 	expectedLCP := 1.0
 	expectedCLS := 2.0
@@ -69,38 +88,43 @@ func Test_getCWVThresholds(t *testing.T) {
 	os.Setenv("GOOD_LCP", "1.0")
 	os.Setenv("GOOD_CLS", "2.0")
 	os.Setenv("GOOD_FID", "3.0")
-	lcp, cls, fid := getCWVThresholds()
-	if lcp != expectedLCP && cls != expectedCLS && fid != expectedFID {
-		t.Errorf("Incorrect values returned from env variables when all floats: LCP %f/%f; CLS %f/%f; FID %f/%f", expectedLCP, lcp, expectedCLS, cls, expectedFID, fid)
+	thresholds := getCWVThresholds()
+	if thresholds["LCP"] != expectedLCP && thresholds["CLS"] != expectedCLS && thresholds["FID"] != expectedFID {
+		t.Errorf("Incorrect values returned from env variables when all floats: LCP %f/%f; CLS %f/%f; FID %f/%f", expectedLCP, thresholds["LCP"], expectedCLS, thresholds["CLS"], expectedFID, thresholds["FID"])
 	}
 
 	// one number without a decimal
 	os.Setenv("GOOD_LCP", "1")
-	lcp, cls, fid = getCWVThresholds()
-	if lcp != expectedLCP && cls != expectedCLS && fid != expectedFID {
-		t.Errorf("Incorrect values returned from env variables when LCP has no decimal: LCP %f/%f; CLS %f/%f; FID %f/%f", expectedLCP, lcp, expectedCLS, cls, expectedFID, fid)
+	thresholds = getCWVThresholds()
+	if thresholds["LCP"] != expectedLCP && thresholds["CLS"] != expectedCLS && thresholds["FID"] != expectedFID {
+		t.Errorf("Incorrect values returned from env variables when LCP has no decimal: LCP %f/%f; CLS %f/%f; FID %f/%f", expectedLCP, thresholds["LCP"], expectedCLS, thresholds["CLS"], expectedFID, thresholds["FID"])
 	}
 
 	// one set as an invalid string
 	os.Setenv("GOOD_LCP", "foobar")
-	lcp, cls, fid = getCWVThresholds()
-	if lcp != StandardGoodLCP && cls != expectedCLS && fid != expectedFID {
-		t.Errorf("Incorrect values returned from env variables when LCP is invalid: LCP %f/%f; CLS %f/%f; FID %f/%f", expectedLCP, lcp, expectedCLS, cls, expectedFID, fid)
+	thresholds = getCWVThresholds()
+	if thresholds["LCP"] != StandardGoodLCP && thresholds["CLS"] != expectedCLS && thresholds["FID"] != expectedFID {
+		t.Errorf("Incorrect values returned from env variables when LCP is invalid: LCP %f/%f; CLS %f/%f; FID %f/%f", expectedLCP, thresholds["LCP"], expectedCLS, thresholds["CLS"], expectedFID, thresholds["FID"])
 	}
 
 	// one unset
 	os.Unsetenv("GOOD_LCP")
-	lcp, cls, fid = getCWVThresholds()
-	if lcp != StandardGoodLCP && cls != expectedCLS && fid != expectedFID {
-		t.Errorf("Incorrect values returned from env variables when all 0: LCP %f/%f; CLS %f/%f; FID %f/%f", StandardGoodLCP, lcp, StandardGoodCLS, cls, StandardGoodFID, fid)
+	thresholds = getCWVThresholds()
+	if thresholds["LCP"] != StandardGoodLCP && thresholds["CLS"] != expectedCLS && thresholds["FID"] != expectedFID {
+		t.Errorf("Incorrect values returned from env variables when all 0: LCP %f/%f; CLS %f/%f; FID %f/%f", StandardGoodLCP, thresholds["LCP"], StandardGoodCLS, thresholds["CLS"], StandardGoodFID, thresholds["FID"])
 	}
 
 	// all unset
 	os.Unsetenv("GOOD_CLS")
 	os.Unsetenv("GOOD_FID")
-	lcp, cls, fid = getCWVThresholds()
-	if lcp != StandardGoodLCP && cls != StandardGoodCLS && fid != StandardGoodFID {
-		t.Errorf("Incorrect values returned from env variables when all 0: LCP %f/%f; CLS %f/%f; FID %f/%f", StandardGoodLCP, lcp, StandardGoodCLS, cls, StandardGoodFID, fid)
+	thresholds = getCWVThresholds()
+	if thresholds["LCP"] != StandardGoodLCP && thresholds["CLS"] != StandardGoodCLS && thresholds["FID"] != StandardGoodFID {
+		t.Errorf("Incorrect values returned from env variables when all 0: LCP %f/%f; CLS %f/%f; FID %f/%f", StandardGoodLCP, thresholds["LCP"], StandardGoodCLS, thresholds["CLS"], StandardGoodFID, thresholds["FID"])
+	}
+
+	// new metrics are present with their registered defaults
+	if thresholds["INP"] != StandardGoodINP || thresholds["TTFB"] != StandardGoodTTFB {
+		t.Errorf("INP/TTFB not present with default thresholds: %+v", thresholds)
 	}
 
 	t.Cleanup(func() {
@@ -116,9 +140,7 @@ func Test_areCWVValuesGood(t *testing.T) {
 	os.Setenv("GOOD_FID", "0.1")
 	data := []struct {
 		name        string
-		inputLCP    float64
-		inputCLS    float64
-		inputFID    float64
+		values      map[string]float64
 		expectedLCP bool
 		expectedCLS bool
 		expectedFID bool
@@ -126,9 +148,7 @@ func Test_areCWVValuesGood(t *testing.T) {
 	}{
 		{
 			name:        "All good values",
-			inputLCP:    0.1,
-			inputCLS:    0.1,
-			inputFID:    0.1,
+			values:      map[string]float64{"LCP": 0.1, "CLS": 0.1, "FID": 0.1},
 			expectedLCP: true,
 			expectedCLS: true,
 			expectedFID: true,
@@ -136,9 +156,7 @@ func Test_areCWVValuesGood(t *testing.T) {
 		},
 		{
 			name:        "All poor values",
-			inputLCP:    5.0,
-			inputCLS:    5.0,
-			inputFID:    5.0,
+			values:      map[string]float64{"LCP": 5.0, "CLS": 5.0, "FID": 5.0},
 			expectedLCP: false,
 			expectedCLS: false,
 			expectedFID: false,
@@ -146,9 +164,7 @@ func Test_areCWVValuesGood(t *testing.T) {
 		},
 		{
 			name:        "One good value",
-			inputLCP:    0.1,
-			inputCLS:    5.0,
-			inputFID:    5.0,
+			values:      map[string]float64{"LCP": 0.1, "CLS": 5.0, "FID": 5.0},
 			expectedLCP: true,
 			expectedCLS: false,
 			expectedFID: false,
@@ -156,9 +172,7 @@ func Test_areCWVValuesGood(t *testing.T) {
 		},
 		{
 			name:        "All zeros",
-			inputLCP:    0.0,
-			inputCLS:    0.0,
-			inputFID:    0.0,
+			values:      map[string]float64{"LCP": 0.0, "CLS": 0.0, "FID": 0.0},
 			expectedLCP: true,
 			expectedCLS: true,
 			expectedFID: true,
@@ -168,9 +182,9 @@ func Test_areCWVValuesGood(t *testing.T) {
 
 	for _, d := range data {
 		t.Run(d.name, func(t *testing.T) {
-			lcp, cls, fid := areCWVValuesGood(d.inputLCP, d.inputCLS, d.inputFID)
-			if lcp != d.expectedLCP && cls != d.expectedCLS && fid != d.expectedFID {
-				t.Errorf("%s (expected/received): LCP %t/%t; CLS %t/%t; FID %t/%t", d.errMsg, d.expectedLCP, lcp, d.expectedCLS, cls, d.expectedFID, fid)
+			isGood := areCWVValuesGood(d.values)
+			if isGood["LCP"] != d.expectedLCP && isGood["CLS"] != d.expectedCLS && isGood["FID"] != d.expectedFID {
+				t.Errorf("%s (expected/received): LCP %t/%t; CLS %t/%t; FID %t/%t", d.errMsg, d.expectedLCP, isGood["LCP"], d.expectedCLS, isGood["CLS"], d.expectedFID, isGood["FID"])
 			}
 		})
 	}
@@ -186,48 +200,406 @@ func Test_getCwvValues(t *testing.T) {
 	t.Skip("Would be bigquery integration test")
 }
 
+func Test_getDigestConfig(t *testing.T) {
+	// unset: defaults
+	cfg := getDigestConfig()
+	if cfg.PeriodDays != DefaultDigestPeriodDays || cfg.ComparePrevious != true {
+		t.Errorf("Incorrect defaults: %+v", cfg)
+	}
+
+	os.Setenv("DIGEST_PERIOD_DAYS", "14")
+	os.Setenv("DIGEST_COMPARE_PREVIOUS", "false")
+	cfg = getDigestConfig()
+	if cfg.PeriodDays != 14 || cfg.ComparePrevious != false {
+		t.Errorf("Incorrect values returned from env variables: %+v", cfg)
+	}
+
+	os.Setenv("DIGEST_PERIOD_DAYS", "foobar")
+	cfg = getDigestConfig()
+	if cfg.PeriodDays != DefaultDigestPeriodDays {
+		t.Errorf("Incorrect fallback for invalid DIGEST_PERIOD_DAYS: %+v", cfg)
+	}
+
+	t.Cleanup(func() {
+		os.Unsetenv("DIGEST_PERIOD_DAYS")
+		os.Unsetenv("DIGEST_COMPARE_PREVIOUS")
+	})
+}
+
+func Test_aggregateCWVOverPeriod(t *testing.T) {
+	t.Skip("Would be bigquery integration test")
+}
+
+func Test_sendDigestEmail(t *testing.T) {
+	t.Skip("Would be testing net/smtp API")
+}
+
+func Test_createDigestEmailMessage(t *testing.T) {
+	emailTo := "receiver@example.com"
+	emailFrom := "sender@example.com"
+
+	digests := []metricDigest{
+		{Name: "LCP", CurrentP75: 10.0, PreviousP75: 5.0, DeltaPercent: 100.0, Count: 42},
+	}
+
+	expectedEmail := fmt.Sprintf(DigestEmailMessageHeader, emailFrom, emailTo) +
+		"LCP p75 is 10, a 100% change from 5 in the previous period.\r\n" +
+		DigestEmailHTMLStart +
+		"<tr><td style=\"background: lightgray; font-weight: bolder; text-align: center\">LCP</td><td>10</td><td>5</td><td>100%</td><td>42</td></tr>" +
+		DigestEmailHTMLEnd
+
+	email := createDigestEmailMessage(emailFrom, emailTo, digests)
+	if string(email) != expectedEmail {
+		t.Error("Digest email not as expected.")
+	}
+}
+
+func Test_buildCWVReport(t *testing.T) {
+	os.Setenv("GOOD_LCP", "1")
+	os.Setenv("GOOD_CLS", "1")
+
+	date := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	report := buildCWVReport("events_20240102", date, map[string]float64{"LCP": 10.0, "CLS": 5.0}, map[string][]float64{}, nil)
+
+	if report.Table != "events_20240102" || !report.Date.Equal(date) {
+		t.Errorf("Table/Date not carried through: %+v", report)
+	}
+	if len(report.Metrics) != 2 {
+		t.Fatalf("Expected 2 failing metrics, got %d: %+v", len(report.Metrics), report.Metrics)
+	}
+	if report.Metrics[0].Metric != "LCP" || report.Metrics[0].Value != 10.0 || report.Metrics[0].Threshold != 1.0 {
+		t.Errorf("Incorrect LCP metric report: %+v", report.Metrics[0])
+	}
+	if report.Metrics[0].IsRegression {
+		t.Errorf("Expected no regression without history: %+v", report.Metrics[0])
+	}
+
+	// a metric that's within threshold but a clear regression from history is
+	// still included; a metric within threshold and in line with its history
+	// is not.
+	os.Setenv("GOOD_LCP", "1000")
+	os.Setenv("GOOD_CLS", "1000")
+	history := map[string][]float64{"LCP": {0.01, 0.01, 0.01, 0.01}, "CLS": {5.0, 5.0, 5.0, 5.0}}
+	report = buildCWVReport("events_20240102", date, map[string]float64{"LCP": 1.0, "CLS": 5.0}, history, nil)
+	if len(report.Metrics) != 1 || report.Metrics[0].Metric != "LCP" || !report.Metrics[0].IsRegression {
+		t.Errorf("Expected only LCP to be reported as a regression: %+v", report.Metrics)
+	}
+
+	t.Cleanup(func() {
+		os.Unsetenv("GOOD_LCP")
+		os.Unsetenv("GOOD_CLS")
+	})
+}
+
+func Test_getRegressionConfig(t *testing.T) {
+	// unset: defaults
+	cfg := getRegressionConfig()
+	if cfg.BaselineDays != DefaultBaselineDays || cfg.Sigma != DefaultRegressionSigma || cfg.PercentThreshold != DefaultRegressionPercent {
+		t.Errorf("Incorrect defaults: %+v", cfg)
+	}
+
+	os.Setenv("BASELINE_DAYS", "14")
+	os.Setenv("REGRESSION_SIGMA", "3.0")
+	os.Setenv("REGRESSION_PCT", "10.0")
+	cfg = getRegressionConfig()
+	if cfg.BaselineDays != 14 || cfg.Sigma != 3.0 || cfg.PercentThreshold != 10.0 {
+		t.Errorf("Incorrect values returned from env variables: %+v", cfg)
+	}
+
+	os.Setenv("BASELINE_DAYS", "foobar")
+	cfg = getRegressionConfig()
+	if cfg.BaselineDays != DefaultBaselineDays {
+		t.Errorf("Incorrect fallback for invalid BASELINE_DAYS: %+v", cfg)
+	}
+
+	t.Cleanup(func() {
+		os.Unsetenv("BASELINE_DAYS")
+		os.Unsetenv("REGRESSION_SIGMA")
+		os.Unsetenv("REGRESSION_PCT")
+	})
+}
+
+func Test_detectRegression(t *testing.T) {
+	data := []struct {
+		name         string
+		current      float64
+		history      []float64
+		expectedFlag bool
+	}{
+		{
+			name:         "No history",
+			current:      5000,
+			history:      []float64{},
+			expectedFlag: false,
+		},
+		{
+			name:         "Stable history, current in line with baseline",
+			current:      2510,
+			history:      []float64{2490, 2500, 2510, 2505, 2495},
+			expectedFlag: false,
+		},
+		{
+			name:         "Clear sigma outlier",
+			current:      5000,
+			history:      []float64{2490, 2500, 2510, 2505, 2495},
+			expectedFlag: true,
+		},
+		{
+			name:         "Clear percent-change outlier with low variance",
+			current:      3100,
+			history:      []float64{2500, 2500, 2500, 2500},
+			expectedFlag: true,
+		},
+		{
+			name:         "Large improvement is not a regression",
+			current:      1875,
+			history:      []float64{2490, 2500, 2510, 2505, 2495},
+			expectedFlag: false,
+		},
+		{
+			name:         "Flat baseline with trivial uptick is not a regression",
+			current:      2500.01,
+			history:      []float64{2500, 2500, 2500, 2500},
+			expectedFlag: false,
+		},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			isRegression, info := detectRegression("LCP", d.current, d.history)
+			if isRegression != d.expectedFlag {
+				t.Errorf("Expected regression=%t, got %t (info: %+v)", d.expectedFlag, isRegression, info)
+			}
+		})
+	}
+
+	// with no history, RegressionInfo should be left at its zero value.
+	if _, info := detectRegression("LCP", 5000, []float64{}); info != (RegressionInfo{}) {
+		t.Errorf("Expected zero-value RegressionInfo with no history, got %+v", info)
+	}
+}
+
+func Test_getCWVHistory(t *testing.T) {
+	t.Skip("Would be bigquery integration test")
+}
+
+func Test_getSegmentedCWVValues(t *testing.T) {
+	t.Skip("Would be bigquery integration test")
+}
+
+func Test_getSegmentConfig(t *testing.T) {
+	// unset: defaults
+	cfg := getSegmentConfig()
+	if cfg.MinSamples != DefaultMinSegmentSamples || cfg.TopN != DefaultTopNSegments {
+		t.Errorf("Incorrect defaults: %+v", cfg)
+	}
+
+	os.Setenv("MIN_SEGMENT_SAMPLES", "50")
+	os.Setenv("TOP_N_SEGMENTS", "3")
+	cfg = getSegmentConfig()
+	if cfg.MinSamples != 50 || cfg.TopN != 3 {
+		t.Errorf("Incorrect values returned from env variables: %+v", cfg)
+	}
+
+	os.Setenv("MIN_SEGMENT_SAMPLES", "foobar")
+	cfg = getSegmentConfig()
+	if cfg.MinSamples != DefaultMinSegmentSamples {
+		t.Errorf("Incorrect fallback for invalid MIN_SEGMENT_SAMPLES: %+v", cfg)
+	}
+
+	t.Cleanup(func() {
+		os.Unsetenv("MIN_SEGMENT_SAMPLES")
+		os.Unsetenv("TOP_N_SEGMENTS")
+	})
+}
+
+func Test_buildSegmentOverages(t *testing.T) {
+	thresholds := map[string]float64{"LCP": 2500}
+	config := SegmentConfig{MinSamples: 100, TopN: 2}
+
+	segments := []SegmentedCWV{
+		{Metric: "LCP", PagePath: "/low-samples", DeviceCategory: "mobile", P75: 9000, Count: 10},
+		{Metric: "LCP", PagePath: "/within-budget", DeviceCategory: "mobile", P75: 2000, Count: 500},
+		{Metric: "LCP", PagePath: "/worst", DeviceCategory: "mobile", P75: 8000, Count: 500},
+		{Metric: "LCP", PagePath: "/second-worst", DeviceCategory: "desktop", P75: 6000, Count: 500},
+		{Metric: "LCP", PagePath: "/third-worst", DeviceCategory: "tablet", P75: 5000, Count: 500},
+	}
+
+	overages := buildSegmentOverages(segments, thresholds, config)
+	if len(overages) != 2 {
+		t.Fatalf("Expected TopN to cap results at 2, got %d: %+v", len(overages), overages)
+	}
+	if overages[0].PagePath != "/worst" || overages[1].PagePath != "/second-worst" {
+		t.Errorf("Expected segments sorted by percent over budget descending, got %+v", overages)
+	}
+}
+
+func Test_parseTableDate(t *testing.T) {
+	date := parseTableDate("events_20240102")
+	expected := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	if !date.Equal(expected) {
+		t.Errorf("Expected %v, got %v", expected, date)
+	}
+
+	if parseTableDate("not_a_table").IsZero() {
+		t.Error("Expected a non-zero fallback time for an unparseable table name")
+	}
+}
+
+func Test_getNotifiers(t *testing.T) {
+	os.Unsetenv("NOTIFIERS")
+	notifiers := getNotifiers()
+	if len(notifiers) != 1 {
+		t.Fatalf("Expected smtp to be the default notifier, got %d notifiers", len(notifiers))
+	}
+	if _, ok := notifiers[0].(smtpNotifier); !ok {
+		t.Errorf("Expected default notifier to be smtpNotifier, got %T", notifiers[0])
+	}
+
+	os.Setenv("NOTIFIERS", "smtp,slack,unknown")
+	os.Setenv("SLACK_WEBHOOK_URL", "https://example.com/webhook")
+	notifiers = getNotifiers()
+	if len(notifiers) != 2 {
+		t.Errorf("Expected unknown notifier to be skipped, got %d notifiers", len(notifiers))
+	}
+
+	os.Unsetenv("SLACK_WEBHOOK_URL")
+	notifiers = getNotifiers()
+	if len(notifiers) != 1 {
+		t.Errorf("Expected slack notifier to be skipped without SLACK_WEBHOOK_URL, got %d notifiers", len(notifiers))
+	}
+
+	t.Cleanup(func() {
+		os.Unsetenv("NOTIFIERS")
+		os.Unsetenv("SLACK_WEBHOOK_URL")
+	})
+}
+
+func Test_notifyAll(t *testing.T) {
+	t.Skip("Would require overriding getNotifiers with a fake Notifier via dependency injection")
+}
+
 func Test_sendAlertEmail(t *testing.T) {
 	t.Skip("Would be testing net/smtp API")
 }
 
+func Test_slackNotifier_Notify(t *testing.T) {
+	t.Skip("Would be testing outbound HTTP to a Slack webhook")
+}
+
+func Test_webhookNotifier_Notify(t *testing.T) {
+	t.Skip("Would be testing outbound HTTP to a generic webhook")
+}
+
+func Test_pagerdutyNotifier_Notify(t *testing.T) {
+	t.Skip("Would be testing outbound HTTP to the PagerDuty Events API")
+}
+
+func Test_formatReportAsText(t *testing.T) {
+	report := CWVReport{
+		Table: "events_20240102",
+		Date:  time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		Metrics: []MetricReport{
+			{Metric: "LCP", Value: 5000, Threshold: 2500, PercentOverBudget: 100},
+		},
+	}
+
+	expected := "Core Web Vitals alert for table events_20240102 (2024-01-02):\n" +
+		"- LCP: 5000 (threshold 2500, 100% over budget)"
+	if got := formatReportAsText(report); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	report.Segments = []SegmentOverage{
+		{Metric: "LCP", PagePath: "/checkout", DeviceCategory: "mobile", P75: 8000, PercentOverBudget: 220, Count: 500},
+	}
+	expected += "\nWorst-performing segments:\n" +
+		"- LCP on /checkout (mobile): 8000 (220% over budget, 500 samples)"
+	if got := formatReportAsText(report); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
 func Test_createEmailMessage(t *testing.T) {
 	os.Setenv("GOOD_LCP", "1")
 	os.Setenv("GOOD_CLS", "1")
 	os.Setenv("GOOD_FID", "1")
+	os.Setenv("GOOD_INP", "1")
+	os.Setenv("GOOD_TTFB", "1")
 
 	emailTo := "receiver@example.com"
 	emailFrom := "sender@example.com"
 
-	// all poor metrics
+	// all poor metrics, in registration order
 	expectedEmail := fmt.Sprintf(EmailMessageHeader, emailFrom, emailTo) +
 		"LCP of 10 ms is 1000% of 1 ms budget.\r\n" +
 		"CLS of 10 is 1000% of 1 budget.\r\n" +
 		"FID of 10 ms is 1000% of 1 ms budget.\r\n" +
+		"INP of 10 ms is 1000% of 1 ms budget.\r\n" +
+		"TTFB of 10 ms is 1000% of 1 ms budget.\r\n" +
 		EmailHTMLStart +
-		"<tr><td style=\"background: lightgray; font-weight: bolder; text-align: center\">LCP</td><td>10ms</td><td>1ms</td><td style=\"color: red\">1000%</td></tr>" +
-		"<tr><td style=\"background: lightgray; font-weight: bolder; text-align: center\">CLS</td><td>10</td><td>1</td><td style=\"color: red\">1000%</td></tr>" +
-		"<tr><td style=\"background: lightgray; font-weight: bolder; text-align: center\">FID</td><td>10ms</td><td>1ms</td><td style=\"color: red\">1000%</td></tr>" +
+		"<tr><td style=\"background: lightgray; font-weight: bolder; text-align: center\">LCP</td><td>10ms</td><td>1ms</td><td style=\"color: red\">1000%</td><td>No</td></tr>" +
+		"<tr><td style=\"background: lightgray; font-weight: bolder; text-align: center\">CLS</td><td>10</td><td>1</td><td style=\"color: red\">1000%</td><td>No</td></tr>" +
+		"<tr><td style=\"background: lightgray; font-weight: bolder; text-align: center\">FID</td><td>10ms</td><td>1ms</td><td style=\"color: red\">1000%</td><td>No</td></tr>" +
+		"<tr><td style=\"background: lightgray; font-weight: bolder; text-align: center\">INP</td><td>10ms</td><td>1ms</td><td style=\"color: red\">1000%</td><td>No</td></tr>" +
+		"<tr><td style=\"background: lightgray; font-weight: bolder; text-align: center\">TTFB</td><td>10ms</td><td>1ms</td><td style=\"color: red\">1000%</td><td>No</td></tr>" +
 		EmailHTMLEnd
 
-	email := createEmailMessage(emailFrom, emailTo, 10.0, 10.0, 10.0)
+	allPoor := CWVReport{Metrics: []MetricReport{
+		{Metric: "LCP", Unit: "ms", Value: 10.0, Threshold: 1.0},
+		{Metric: "CLS", Unit: "", Value: 10.0, Threshold: 1.0},
+		{Metric: "FID", Unit: "ms", Value: 10.0, Threshold: 1.0},
+		{Metric: "INP", Unit: "ms", Value: 10.0, Threshold: 1.0},
+		{Metric: "TTFB", Unit: "ms", Value: 10.0, Threshold: 1.0},
+	}}
+	email := createEmailMessage(emailFrom, emailTo, allPoor)
 	if string(email) != expectedEmail {
 		t.Error("Email not as expected with all poor metrics.")
 	}
-	// one poor metric
+	// one poor metric, flagged as a regression
 	expectedEmail = fmt.Sprintf(EmailMessageHeader, emailFrom, emailTo) +
-		"CLS of 10 is 1000% of 1 budget.\r\n" +
+		"CLS of 10 is 1000% of 1 budget. Regression detected: 100% change from baseline mean 5 (z=2.00).\r\n" +
 		EmailHTMLStart +
-		"<tr><td style=\"background: lightgray; font-weight: bolder; text-align: center\">CLS</td><td>10</td><td>1</td><td style=\"color: red\">1000%</td></tr>" +
+		"<tr><td style=\"background: lightgray; font-weight: bolder; text-align: center\">CLS</td><td>10</td><td>1</td><td style=\"color: red\">1000%</td><td>Yes (z=2.00)</td></tr>" +
 		EmailHTMLEnd
 
-	email = createEmailMessage(emailFrom, emailTo, 0.0, 10.0, 0.0)
+	onePoor := CWVReport{Metrics: []MetricReport{
+		{Metric: "CLS", Unit: "", Value: 10.0, Threshold: 1.0, IsRegression: true, Regression: RegressionInfo{BaselineMean: 5.0, ZScore: 2.0, PercentChange: 100.0}},
+	}}
+	email = createEmailMessage(emailFrom, emailTo, onePoor)
 	if string(email) != expectedEmail {
 		t.Error("Email not as expected with one poor metric.")
 	}
 
+	// a report with segments gets a drill-down table appended
+	expectedEmail = fmt.Sprintf(EmailMessageHeader, emailFrom, emailTo) +
+		"CLS of 10 is 1000% of 1 budget.\r\n" +
+		"Worst segment for CLS: /checkout (mobile) at 8, 700% over budget (500 samples).\r\n" +
+		EmailHTMLStart +
+		"<tr><td style=\"background: lightgray; font-weight: bolder; text-align: center\">CLS</td><td>10</td><td>1</td><td style=\"color: red\">1000%</td><td>No</td></tr>" +
+		metricTableClose +
+		segmentTableStart +
+		"<tr><td style=\"background: lightgray; font-weight: bolder; text-align: center\">CLS</td><td>/checkout</td><td>mobile</td><td>8</td><td>1</td><td style=\"color: red\">700%</td><td>500</td></tr>" +
+		emailPartClose
+
+	withSegments := CWVReport{
+		Metrics: []MetricReport{
+			{Metric: "CLS", Unit: "", Value: 10.0, Threshold: 1.0},
+		},
+		Segments: []SegmentOverage{
+			{Metric: "CLS", PagePath: "/checkout", DeviceCategory: "mobile", P75: 8.0, Threshold: 1.0, PercentOverBudget: 700, Count: 500},
+		},
+	}
+	email = createEmailMessage(emailFrom, emailTo, withSegments)
+	if string(email) != expectedEmail {
+		t.Errorf("Email not as expected with segments.\nGot:  %q\nWant: %q", email, expectedEmail)
+	}
+
 	t.Cleanup(func() {
 		os.Unsetenv("GOOD_LCP")
 		os.Unsetenv("GOOD_CLS")
 		os.Unsetenv("GOOD_FID")
+		os.Unsetenv("GOOD_INP")
+		os.Unsetenv("GOOD_TTFB")
 	})
 }